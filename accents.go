@@ -0,0 +1,24 @@
+/* See LICENSE for license details. */
+package aozora2fmt
+
+import (
+	"regexp"
+	"strings"
+)
+
+var accent_bracket_exp = regexp.MustCompile(`〔([^〕]+)〕`)
+
+/* apply_accents expands Aozora's bracketed Latin accent-separation
+   notation, e.g. "〔a^〕" for "â", in place. */
+func apply_accents(str string) string {
+	for _, matches := range accent_bracket_exp.FindAllStringSubmatch(str, -1) {
+		str = strings.Replace(str, matches[0], matches[1], -1)
+
+		m := AccentMap()
+		for key := range m {
+			str = strings.ReplaceAll(str, key, m[key])
+		}
+	}
+
+	return str
+}
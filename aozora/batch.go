@@ -0,0 +1,179 @@
+/* See LICENSE for license details. */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"aozora2fmt"
+)
+
+/* expand_globs resolves patterns to a deduplicated, sorted file list.
+   Patterns follow path/filepath.Match, plus a "**" path component that
+   matches any number of directories, as fnmatch's FNM_PATHNAME does for
+   "*". */
+func expand_globs(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+
+	for _, pattern := range patterns {
+		matches, err := glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				out = append(out, m)
+			}
+		}
+	}
+
+	sort.Strings(out)
+	return out, nil
+}
+
+func glob(pattern string) ([]string, error) {
+	idx := strings.Index(pattern, "**")
+	if idx == -1 {
+		return filepath.Glob(pattern)
+	}
+
+	base := filepath.Dir(pattern[:idx])
+	rest := strings.TrimPrefix(pattern[idx+2:], "/")
+
+	var matches []string
+	err := filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+
+		if rest == "" {
+			matches = append(matches, path)
+			return nil
+		}
+
+		/* "**" stands for any number of directories, so try rest
+		   against rel and each of its trailing sub-paths. */
+		parts := strings.Split(rel, string(filepath.Separator))
+		for i := range parts {
+			ok, err := filepath.Match(rest, filepath.Join(parts[i:]...))
+			if err != nil {
+				return err
+			}
+			if ok {
+				matches = append(matches, path)
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return matches, err
+}
+
+func ext_for_format(format string) string {
+	switch format {
+	case "md":
+		return ".md"
+	case "tex":
+		return ".tex"
+	case "html":
+		return ".html"
+	case "epub":
+		return ".epub"
+	default:
+		return ".txt"
+	}
+}
+
+/* process_file renders file (or stdin, for file == "-") to outdir, or
+   to stdout when outdir is empty. */
+func process_file(file, format string, debug bool, enc, outdir string) error {
+	var r io.Reader = os.Stdin
+
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	doc, err := aozora2fmt.Parse(open_decoded(r, enc), debug)
+	if err != nil {
+		return err
+	}
+
+	renderer, err := get_renderer(format)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := doc.Render(&buf, renderer); err != nil {
+		return err
+	}
+
+	if outdir == "" {
+		fmt.Printf("%s\n", buf.String())
+		return nil
+	}
+
+	name := "stdin"
+	if file != "-" {
+		name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	out := filepath.Join(outdir, name+ext_for_format(format))
+
+	if format == "epub" {
+		return write_epub(out, name, buf.String())
+	}
+
+	return os.WriteFile(out, []byte(buf.String()+"\n"), 0644)
+}
+
+/* run_batch fans process_file out across GOMAXPROCS workers, logging
+   per-file failures rather than aborting the whole run. */
+func run_batch(files []string, format string, debug bool, enc, outdir string) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				if err := process_file(file, format, debug, enc, outdir); err != nil {
+					log.Printf("%s: %v\n", file, err)
+				}
+			}
+		}()
+	}
+
+	for _, file := range files {
+		jobs <- file
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,139 @@
+/* See LICENSE for license details. */
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"os"
+)
+
+const epub_css = `
+html { writing-mode: vertical-rl; -epub-writing-mode: vertical-rl; }
+body { line-height: 1.75; }
+ruby rt { font-size: 0.5em; }
+.bouten { text-emphasis-style: sesame; -webkit-text-emphasis-style: sesame; }
+`
+
+const epub_container_xml = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func epub_opf(title, uid string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>ja</dc:language>
+  </metadata>
+  <manifest>
+    <item id="content" href="content.xhtml" media-type="application/xhtml+xml"/>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="content"/>
+  </spine>
+</package>
+`, html.EscapeString(uid), html.EscapeString(title))
+}
+
+func epub_nav_xhtml(title string) string {
+	title = html.EscapeString(title)
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>%s</title></head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <ol>
+      <li><a href="content.xhtml">%s</a></li>
+    </ol>
+  </nav>
+</body>
+</html>
+`, title, title)
+}
+
+func epub_ncx(title, uid string) string {
+	title, uid = html.EscapeString(title), html.EscapeString(uid)
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+    <meta name="dtb:uid" content="%s"/>
+  </head>
+  <docTitle><text>%s</text></docTitle>
+  <navMap>
+    <navPoint id="navpoint-1" playOrder="1">
+      <navLabel><text>%s</text></navLabel>
+      <content src="content.xhtml"/>
+    </navPoint>
+  </navMap>
+</ncx>
+`, uid, title, title)
+}
+
+/* epub_content_xhtml wraps body, already rendered by aozora2fmt's epub
+   Renderer, in the surrounding XHTML document. title is escaped here;
+   body comes pre-escaped from the epub Renderer. */
+func epub_content_xhtml(title, body string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>%s</title><link rel="stylesheet" type="text/css" href="style.css"/></head>
+<body>
+%s</body>
+</html>
+`, html.EscapeString(title), body)
+}
+
+/* write_epub packages out into an EPUB3 at path, using title for the
+   book's metadata and table of contents. */
+func write_epub(path, title, out string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	defer zw.Close()
+
+	uid := "urn:aozora2fmt:" + title
+
+	files := []struct {
+		name    string
+		content string
+		store   bool /* store instead of deflate, required for mimetype */
+	}{
+		{"mimetype", "application/epub+zip", true},
+		{"META-INF/container.xml", epub_container_xml, false},
+		{"OEBPS/content.opf", epub_opf(title, uid), false},
+		{"OEBPS/nav.xhtml", epub_nav_xhtml(title), false},
+		{"OEBPS/toc.ncx", epub_ncx(title, uid), false},
+		{"OEBPS/style.css", epub_css, false},
+		{"OEBPS/content.xhtml", epub_content_xhtml(title, out), false},
+	}
+
+	for _, file := range files {
+		method := zip.Deflate
+		if file.store {
+			method = zip.Store
+		}
+
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: method})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, file.content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
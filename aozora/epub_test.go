@@ -0,0 +1,26 @@
+/* See LICENSE for license details. */
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEpubXMLEscapesTitle(t *testing.T) {
+	const title = "A & B"
+	uid := "urn:aozora2fmt:" + title
+
+	for _, doc := range []string{
+		epub_opf(title, uid),
+		epub_nav_xhtml(title),
+		epub_ncx(title, uid),
+		epub_content_xhtml(title, "<p>body</p>"),
+	} {
+		if strings.Contains(doc, "A & B") {
+			t.Errorf("unescaped %q leaked into generated XML:\n%s", title, doc)
+		}
+		if !strings.Contains(doc, "A &amp; B") {
+			t.Errorf("expected escaped title in generated XML:\n%s", doc)
+		}
+	}
+}
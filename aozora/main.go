@@ -3,206 +3,198 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"regexp"
-	"strconv"
-	"strings"
 	"unicode/utf8"
 
+	"golang.org/x/term"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+
 	"aozora2fmt"
 )
 
-type OutFmt struct {
-	ruby  string /* Ruby output format */
-	hdr   string /* Header format */
-	shdr  string /* Subheader format */
-	sshdr string /* Subsubheader format */
-	pb    string /* Page Break text */
-}
-
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: %s [-d] [-f format] file\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "usage: %s [-d] [-e encoding] [-f format] [-o dir] [-stdin] file...\n", os.Args[0])
 	flag.PrintDefaults()
 }
 
-func get_outfmt(fmt string) *OutFmt {
-	of := new(OutFmt)
-
-	switch fmt {
-	case "tex":
-		of.ruby  = "\\ruby{%s}{%s}"
-		of.hdr   = "\\chapter{%s}"
-		of.shdr  = "\\section*{%s}"
-		of.sshdr = "\\subsection*{%s}"
-		of.pb    = "\\newpage"
-	case "md":
-		of.ruby  = "<ruby>%s<rp>《</rp><rt>%s</rt><rp>》</rp></ruby>"
-		of.hdr   = "# %s"
-		of.shdr  = "## %s"
-		of.sshdr = "### %s"
-		of.pb    = "<div style='break-after:always'></div>"
-	case "plain":
-		of.ruby  = "[%s:%s]"
-		of.hdr   = "%s"
-		of.shdr  = "%s"
-		of.sshdr = "%s"
-		of.pb    = ""
+/* get_renderer picks the Renderer for format, sizing a term renderer to
+   the actual terminal and falling back to plain when stdout isn't one. */
+func get_renderer(format string) (aozora2fmt.Renderer, error) {
+	if format != "term" {
+		return aozora2fmt.NewRenderer(format)
 	}
 
-	return of
-}
-
-func replace_jis(str string) string {
-	exp := regexp.MustCompile(`※［＃([^］]+)］`)
-
-	for _, matches := range exp.FindAllStringSubmatch(str, -1) {
-		sub_exp := regexp.MustCompile(`第(\d)水準(\d)-(\d\d)-(\d\d)`)
-	
-		nums := sub_exp.FindStringSubmatch(str)
-		if nums == nil {
-			/* the same character appeared multiple times in str */
-			continue
-		}
-		num, _ := strconv.Atoi(nums[1] + nums[2] + nums[3] + nums[4])
-
-		m := aozora2fmt.JisMap()
-		replacement, ok := m[num]
-		if !ok {
-			log.Printf("jis code not implemented: %d: %s\n", num, matches[0])
-			continue
-		}
-
-		str = strings.Replace(str, matches[0], replacement, -1)
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return aozora2fmt.NewRenderer("plain")
 	}
 
-	return str
-}
-
-func replace_ruby(str string, of *OutFmt) string {
-	kanji := `\x{3400}-\x{4DBF}` +   /* CJK Unified Ideographs Extension A */
-		 `\x{4E00}-\x{9FFF}` +   /* CJK Unified Ideographs */
-		 `\x{F900}-\x{FAFF}` +   /* CJK Compatibility Ideographs */
-		 `\x{20000}-\x{2FA1F}` + /* CJK Unified Ideographs Extension B - F, Supplement */
-		 `〆〻〇々ヶ`
-	ruby_exp := regexp.MustCompile(`[｜]?([` + kanji + `]+)《([^》]+)》`)
-	for _, matches := range ruby_exp.FindAllStringSubmatch(str, -1) {
-		replacement := fmt.Sprintf(of.ruby, matches[1], matches[2])
-		str = strings.Replace(str, matches[0], replacement, -1)
+	width, _, err := term.GetSize(fd)
+	if err != nil {
+		width = aozora2fmt.MaxTermWidth
 	}
 
-	bouten_exp := regexp.MustCompile(`［＃「([^」]+)」に傍点］`)
-	for _, matches := range bouten_exp.FindAllStringSubmatch(str, -1) {
-		bouten := strings.Repeat("﹅", utf8.RuneCountInString(matches[1]))
-		replacement := fmt.Sprintf(of.ruby, matches[1], bouten)
-		str = strings.Replace(str, matches[1] + matches[0], replacement, -1)
-	}
+	return aozora2fmt.NewTermRenderer(width), nil
+}
 
-	return str
+func has_bom(b []byte) bool {
+	return len(b) >= 3 && b[0] == 0xEF && b[1] == 0xBB && b[2] == 0xBF
 }
 
-func replace_accents(str string) string {
-	exp := regexp.MustCompile(`〔([^〕]+)〕`)
-	
-	for _, matches := range exp.FindAllStringSubmatch(str, -1) {
-		str = strings.Replace(str, matches[0], matches[1], -1)
+func has_jis_escape(b []byte) bool {
+	return bytes.Contains(b, []byte{0x1B, '$', 'B'}) ||
+		bytes.Contains(b, []byte{0x1B, '$', '@'}) ||
+		bytes.Contains(b, []byte{0x1B, '(', 'B'})
+}
 
-		m := aozora2fmt.AccentMap()
-		for key := range m {
-			str = strings.ReplaceAll(str, key, m[key])
+/* true if every byte in b forms a valid Shift_JIS sequence */
+func valid_sjis(b []byte) bool {
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80:
+			continue
+		case c >= 0xA1 && c <= 0xDF:
+			continue /* halfwidth kana */
+		case (c >= 0x81 && c <= 0x9F) || (c >= 0xE0 && c <= 0xFC):
+			if i+1 >= len(b) {
+				return false
+			}
+			n := b[i+1]
+			if n < 0x40 || n == 0x7F || n > 0xFC {
+				return false
+			}
+			i++
+		default:
+			return false
 		}
 	}
-
-	return str
+	return true
 }
 
-func replace_hdrs(str string, of *OutFmt) string {
-	exp := regexp.MustCompile(`\n\n［[^［]+［＃「([^」]+)」は([大中小])見出し］\n\n\n`)
-	slices := exp.FindAllStringSubmatch(str, -1)
-	if slices == nil {
-		exp = regexp.MustCompile(`\n\n\n([^\n]+)\n\n\n`)
-		for _, matches := range exp.FindAllStringSubmatch(str, -1) {
-			replacement := "\n" + fmt.Sprintf(of.hdr, matches[1]) + "\n"
-			str = strings.Replace(str, matches[0], replacement, -1)
+/* trim_trailing_lead drops a trailing Shift_JIS lead byte from b, since
+   a buffered peek may have cut it off before its second byte. */
+func trim_trailing_lead(b []byte) []byte {
+	if n := len(b); n > 0 {
+		c := b[n-1]
+		if (c >= 0x81 && c <= 0x9F) || (c >= 0xE0 && c <= 0xFC) {
+			return b[:n-1]
 		}
-		return str
 	}
+	return b
+}
 
-	for _, matches := range slices {
-		var replacement string
-		switch matches[2] {
-		case "大":
-			replacement = fmt.Sprintf(of.hdr, matches[1])
-		case "中":
-			replacement = fmt.Sprintf(of.shdr, matches[1])
-		case "小":
-			replacement = fmt.Sprintf(of.sshdr, matches[1])
-		default:
-			log.Printf("bad hdr: %s\n", matches[0])
-			replacement = matches[1]
+/* trim_trailing_rune drops a trailing UTF-8 sequence from b that a
+   buffered peek may have cut short before its last continuation byte. */
+func trim_trailing_rune(b []byte) []byte {
+	for i := 1; i <= 4 && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
 		}
-		str = strings.Replace(str, matches[0], replacement + "\n", -1)
 	}
-
-	return str
+	return b
 }
 
-func trim_info(str string) string {
-	delim := "\n" + strings.Repeat("-", 55) + "\n"
-
-	slices := strings.Split(str, delim)
-
-	return strings.Join([]string{slices[0], slices[2]}, "")
+func sniff_encoding(br *bufio.Reader) string {
+	buf, _ := br.Peek(4096)
+
+	switch {
+	case has_bom(buf):
+		return "utf8"
+	case has_jis_escape(buf):
+		return "jis"
+	case utf8.Valid(trim_trailing_rune(buf)):
+		return "utf8"
+	case valid_sjis(trim_trailing_lead(buf)):
+		return "sjis"
+	default:
+		return "eucjp"
+	}
 }
 
-func parse(file string, of *OutFmt, debug bool) string {
-	f, err := os.Open(file)
-	defer f.Close()
-	if err != nil {
-		log.Fatal(err)
+func get_decoder(enc string) encoding.Encoding {
+	switch enc {
+	case "sjis":
+		return japanese.ShiftJIS
+	case "eucjp":
+		return japanese.EUCJP
+	case "jis":
+		return japanese.ISO2022JP
+	default:
+		return encoding.Nop
 	}
+}
 
-	var lines []string
-	r := bufio.NewScanner(f)
-	for r.Scan() {
-		line := strings.Trim(r.Text(), "　")
-		line = replace_jis(line)
-		line = replace_ruby(line, of)
-		line = replace_accents(line)
-		lines = append(lines, line)
-	}
+/* open_decoded wraps r in a decoder for enc, sniffing the encoding from
+   r itself (via a buffered peek, so r need not be seekable) when enc is
+   "auto". */
+func open_decoded(r io.Reader, enc string) io.Reader {
+	br := bufio.NewReader(r)
 
-	out := strings.Join(lines, "\n\n");
-	out = replace_hdrs(out, of)
-	out = strings.Replace(out, "［＃改ページ］", of.pb, -1)
+	if enc == "auto" {
+		enc = sniff_encoding(br)
+	}
 
-	if (debug == false) {
-		out = trim_info(out)
+	if dec := get_decoder(enc); dec != encoding.Nop {
+		return transform.NewReader(br, dec.NewDecoder())
 	}
 
-	return out
+	return br
 }
 
 func main() {
 	var (
-		debug = flag.Bool("d", false, "debug mode")
-		format = flag.String("f", "plain", "output format [plain|md|tex]")
+		debug     = flag.Bool("d", false, "debug mode")
+		encflag   = flag.String("e", "auto", "input encoding [auto|utf8|sjis|eucjp|jis]")
+		format    = flag.String("f", "plain", "output format [plain|md|tex|html|epub|term]")
+		outflag   = flag.String("o", "", "output directory (files are written as DIR/name.ext instead of stdout)")
+		stdinFlag = flag.Bool("stdin", false, "read a single document from stdin")
 	)
 
 	flag.Usage = usage
 	flag.Parse()
 
-	if flag.NArg() != 1 {
-		usage()
-		os.Exit(1)
+	log.SetFlags(log.Lshortfile)
+
+	var files []string
+	if *stdinFlag {
+		files = []string{"-"}
+	} else {
+		if flag.NArg() < 1 {
+			usage()
+			os.Exit(1)
+		}
+
+		expanded, err := expand_globs(flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(expanded) == 0 {
+			log.Fatal("no input files matched")
+		}
+		files = expanded
 	}
 
-	log.SetFlags(log.Lshortfile)
+	if len(files) > 1 && *outflag == "" {
+		log.Fatal("-o dir is required when processing more than one file")
+	}
 
-	of := get_outfmt(*format)
-	out := parse(flag.Arg(0), of, *debug) 
+	if len(files) == 1 {
+		if err := process_file(files[0], *format, *debug, *encflag, *outflag); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	fmt.Printf("%s\n", out)
+	run_batch(files, *format, *debug, *encflag, *outflag)
 }
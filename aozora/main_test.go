@@ -0,0 +1,59 @@
+/* See LICENSE for license details. */
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSniffEncoding(t *testing.T) {
+	/* a 2-byte Shift_JIS char (0x82 0xA0, "あ") whose lead byte lands
+	   exactly on the 4096-byte peek boundary */
+	straddling := append(bytes.Repeat([]byte("A"), 4095), 0x82, 0xA0)
+	straddling = append(straddling, []byte(strings.Repeat("A", 100))...)
+
+	tests := []struct {
+		name string
+		buf  []byte
+		want string
+	}{
+		{"utf8 no bom", []byte("〇〇と言った。\n\nA & B Corp\n\n"), "utf8"},
+		{"utf8 bom", append([]byte{0xEF, 0xBB, 0xBF}, "hello"...), "utf8"},
+		{"jis escape", []byte{0x1B, '$', 'B', 0x24, 0x22, 0x1B, '(', 'B'}, "jis"},
+		{"sjis", []byte{0x82, 0xA0, 0x82, 0xA2}, "sjis"},
+		{"sjis straddling peek boundary", straddling, "sjis"},
+		{"fallback eucjp", bytes.Repeat([]byte{0xFF}, 8), "eucjp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniff_encoding(bufio.NewReader(bytes.NewReader(tt.buf))); got != tt.want {
+				t.Errorf("sniff_encoding() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidSjis(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+		want bool
+	}{
+		{"ascii", []byte("hello"), true},
+		{"halfwidth kana", []byte{0xA1, 0xDF}, true},
+		{"double byte pair", []byte{0x82, 0xA0}, true},
+		{"truncated lead byte", []byte{0x82}, false},
+		{"invalid trail byte", []byte{0x82, 0x7F}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := valid_sjis(tt.buf); got != tt.want {
+				t.Errorf("valid_sjis(%v) = %v, want %v", tt.buf, got, tt.want)
+			}
+		})
+	}
+}
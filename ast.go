@@ -0,0 +1,42 @@
+/* See LICENSE for license details. */
+package aozora2fmt
+
+/* Kind tags a Node's role in the document tree. Aozora's chuki (注記)
+   annotations map onto it roughly 1:1; see the 青空文庫の「注記一覧」. */
+type Kind int
+
+const (
+	KindText        Kind = iota /* plain run of text, always a leaf */
+	KindParagraph               /* a run of inline nodes */
+	KindHeading                 /* Level: 1=大見出し 2=中見出し 3=小見出し */
+	KindRuby                    /* Text=base, Reading=ruby text */
+	KindBouten                  /* Text=emphasised run */
+	KindGaiji                   /* Text=resolved rune/description, Code=chuki source */
+	KindIndent                  /* 字下げ block, Amount=columns, Children=contents */
+	KindJidori                  /* 地付き line, Width=columns from the right margin */
+	KindTatechuyoko             /* 縦中横 run, Text=the run itself */
+	KindPageBreak               /* 改ページ, always a leaf */
+	KindCaption                 /* キャプション block, Children=contents */
+	KindBlockquote              /* 引用 block, Children=contents */
+	KindColophon                /* 底本 block at the end of the file */
+)
+
+/* Node is a single element of a parsed Aozora document. Block kinds
+   (Paragraph, Indent, Caption, Blockquote) carry their contents in
+   Children; inline kinds (Text, Ruby, Bouten, Gaiji, Tatechuyoko) are
+   themselves found inside a Paragraph's Children. */
+type Node struct {
+	Kind     Kind
+	Text     string
+	Reading  string /* Ruby reading */
+	Code     string /* Gaiji chuki source, e.g. "第3水準1-15-13" */
+	Level    int    /* Heading level */
+	Amount   int    /* Indent amount, in columns */
+	Width    int    /* Jidori width, 0 if unspecified */
+	Children []*Node
+}
+
+/* Document is the root of a parsed Aozora document. */
+type Document struct {
+	Nodes []*Node
+}
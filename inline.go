@@ -0,0 +1,124 @@
+/* See LICENSE for license details. */
+package aozora2fmt
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"aozora2fmt/internal/gaiji"
+)
+
+const kanji_ranges = `\x{3400}-\x{4DBF}` + /* CJK Unified Ideographs Extension A */
+	`\x{4E00}-\x{9FFF}` + /* CJK Unified Ideographs */
+	`\x{F900}-\x{FAFF}` + /* CJK Compatibility Ideographs */
+	`\x{20000}-\x{2FA1F}` + /* CJK Unified Ideographs Extension B - F, Supplement */
+	`〆〻〇々ヶ`
+
+var (
+	gaiji_exp   = regexp.MustCompile(`※［＃([^］]+)］`)
+	ruby_exp    = regexp.MustCompile(`[｜]?([` + kanji_ranges + `]+)《([^》]+)》`)
+	bouten_exp  = regexp.MustCompile(`［＃「([^」]+)」に傍点］`)
+	tcy_exp     = regexp.MustCompile(`([0-9A-Za-zー]+)［＃縦中横］`)
+
+	suijun_exp   = regexp.MustCompile(`第(\d)水準(\d)-(\d\d)-(\d\d)`)
+	unicode_exp  = regexp.MustCompile(`U\+([0-9A-Fa-f]{4,6})`)
+	unicode1_exp = regexp.MustCompile(`Unicode1-(\d)-(\d\d)-(\d\d)`)
+)
+
+type inline_match struct {
+	start, end int
+	node       *Node
+}
+
+/* resolve_gaiji dispatches a gaiji chuki's description to gaiji.Lookup,
+   trying the 第N水準M-KK-TT, U+XXXX and Unicode1-XX-XX-XX notation
+   variants before falling back to a bracketed literal of desc itself.
+   The 「…」 component-description form has no resolver yet — gaiji.Lookup
+   only covers the ~30-entry hand-curated table, not a real CHISE IDS
+   index — so it falls straight through to the literal. */
+func resolve_gaiji(desc string) *Node {
+	if nums := suijun_exp.FindStringSubmatch(desc); nums != nil {
+		level, _ := strconv.Atoi(nums[1])
+		plane, _ := strconv.Atoi(nums[2])
+		row, _ := strconv.Atoi(nums[3])
+		cell, _ := strconv.Atoi(nums[4])
+		if r, ok := gaiji.Lookup(level, plane, row, cell); ok {
+			return &Node{Kind: KindGaiji, Text: string(r), Code: desc}
+		}
+	}
+
+	if nums := unicode_exp.FindStringSubmatch(desc); nums != nil {
+		if cp, err := strconv.ParseInt(nums[1], 16, 32); err == nil {
+			return &Node{Kind: KindGaiji, Text: string(rune(cp)), Code: desc}
+		}
+	}
+
+	if nums := unicode1_exp.FindStringSubmatch(desc); nums != nil {
+		plane, _ := strconv.Atoi(nums[1])
+		row, _ := strconv.Atoi(nums[2])
+		cell, _ := strconv.Atoi(nums[3])
+		if r, ok := gaiji.Lookup(1, plane, row, cell); ok {
+			return &Node{Kind: KindGaiji, Text: string(r), Code: desc}
+		}
+	}
+
+	return &Node{Kind: KindGaiji, Text: "［＃" + desc + "］", Code: desc}
+}
+
+/* find_inline_matches locates every gaiji, ruby, bouten and tatechuyoko
+   chuki in line, sorted by position. Matches that overlap an
+   earlier one are left for tokenize_inline to discard. */
+func find_inline_matches(line string) []inline_match {
+	var matches []inline_match
+
+	for _, m := range gaiji_exp.FindAllStringSubmatchIndex(line, -1) {
+		matches = append(matches, inline_match{m[0], m[1], resolve_gaiji(line[m[2]:m[3]])})
+	}
+
+	for _, m := range ruby_exp.FindAllStringSubmatchIndex(line, -1) {
+		node := &Node{Kind: KindRuby, Text: line[m[2]:m[3]], Reading: line[m[4]:m[5]]}
+		matches = append(matches, inline_match{m[0], m[1], node})
+	}
+
+	for _, m := range bouten_exp.FindAllStringSubmatchIndex(line, -1) {
+		inner := line[m[2]:m[3]]
+		base_start := m[0] - len(inner)
+		if base_start < 0 || line[base_start:m[0]] != inner {
+			continue /* the annotated text isn't right before the marker */
+		}
+		matches = append(matches, inline_match{base_start, m[1], &Node{Kind: KindBouten, Text: inner}})
+	}
+
+	for _, m := range tcy_exp.FindAllStringSubmatchIndex(line, -1) {
+		node := &Node{Kind: KindTatechuyoko, Text: line[m[2]:m[3]]}
+		matches = append(matches, inline_match{m[0], m[1], node})
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	return matches
+}
+
+/* tokenize_inline turns a single already-joined paragraph's text into
+   the inline node sequence consumed by a Paragraph node's Children. */
+func tokenize_inline(line string) []*Node {
+	var nodes []*Node
+
+	pos := 0
+	for _, m := range find_inline_matches(line) {
+		if m.start < pos {
+			continue /* overlaps an earlier match */
+		}
+		if m.start > pos {
+			nodes = append(nodes, &Node{Kind: KindText, Text: line[pos:m.start]})
+		}
+		nodes = append(nodes, m.node)
+		pos = m.end
+	}
+	if pos < len(line) {
+		nodes = append(nodes, &Node{Kind: KindText, Text: line[pos:]})
+	}
+
+	return nodes
+}
@@ -0,0 +1,19 @@
+/* See LICENSE for license details. */
+
+/* Package gaiji resolves Aozora Bunko 外字 (gaiji) annotations that
+   reference JIS X 0213 plane/row/cell positions to a Unicode rune.
+   Today that resolution is the same ~30-entry hand-curated table the
+   package replaced (see tables.go); it is not yet backed by the CHISE
+   character database this package is meant to grow into. */
+package gaiji
+
+//go:generate go run ./gen -o tables.go
+
+/* Lookup resolves a "第level水準plane-row-cell" reference, e.g. level 3,
+   plane 1, row 15, cell 13 for "第3水準1-15-13", against jisMap. Most
+   real-world references will miss until jisMap is grown from a real
+   CHISE dump. */
+func Lookup(level, plane, row, cell int) (rune, bool) {
+	r, ok := jisMap[level*100000+plane*10000+row*100+cell]
+	return r, ok
+}
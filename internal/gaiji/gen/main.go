@@ -0,0 +1,83 @@
+/* See LICENSE for license details. */
+
+/* gen rebuilds internal/gaiji/tables.go from a local copy of a CHISE
+   jisx0213.txt-style dump (https://www.chise.org/ids/). It is invoked
+   via `go generate` from internal/gaiji and is not part of the built
+   binary.
+
+   The "level plane row cell codepoint" line format parse_plane_table
+   expects is inferred from CHISE's documentation, not validated
+   against a real dump — no such dump was reachable from the
+   environment this was written in. Treat this as unverified
+   scaffolding until it has actually been run against CHISE data. */
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func parse_plane_table(path string) map[int]rune {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	m := make(map[int]rune)
+	r := bufio.NewScanner(f)
+	for r.Scan() {
+		/* CHISE jisx0213.txt lines: level plane row cell codepoint */
+		fields := strings.Fields(r.Text())
+		if len(fields) != 5 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		level, _ := strconv.Atoi(fields[0])
+		plane, _ := strconv.Atoi(fields[1])
+		row, _ := strconv.Atoi(fields[2])
+		cell, _ := strconv.Atoi(fields[3])
+		cp, err := strconv.ParseInt(strings.TrimPrefix(fields[4], "U+"), 16, 32)
+		if err != nil {
+			continue
+		}
+
+		m[level*100000+plane*10000+row*100+cell] = rune(cp)
+	}
+
+	return m
+}
+
+func write_tables(path string, planes map[int]rune) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, "// Code generated by gen; DO NOT EDIT.")
+	fmt.Fprintln(f)
+	fmt.Fprintln(f, "package gaiji")
+	fmt.Fprintln(f)
+	fmt.Fprintln(f, "var jisMap = map[int]rune{")
+	for k, v := range planes {
+		fmt.Fprintf(f, "\t%d: %q,\n", k, v)
+	}
+	fmt.Fprintln(f, "}")
+}
+
+func main() {
+	var (
+		out     = flag.String("o", "tables.go", "output file")
+		jisDump = flag.String("jisx0213", "jisx0213.txt", "CHISE JIS X 0213 dump")
+	)
+	flag.Parse()
+
+	planes := parse_plane_table(*jisDump)
+	write_tables(*out, planes)
+}
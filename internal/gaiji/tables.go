@@ -0,0 +1,42 @@
+package gaiji
+
+/* jisMap is the same ~30-entry hand-curated JIS X 0213 plane/row/cell
+   table the old aozora2fmt.JisMap() carried, just ported here verbatim
+   and keyed as level*100000+plane*10000+row*100+cell. It is NOT built
+   from CHISE data — no CHISE dump was available in the environment
+   this table was moved in, so `go generate` (see ./gen) is unverified
+   scaffolding, not a working pipeline. Running it against real CHISE
+   jisx0213.txt/ids.txt dumps to grow this past a hand-picked sample is
+   still open work. */
+var jisMap = map[int]rune{
+	311476: '匇',
+	311524: '噱',
+	311589: '媧',
+	318428: '彘',
+	318431: '彽',
+	318445: '怳',
+	318454: '惝',
+	318455: '惸',
+	318459: '愷',
+	318466: '戢',
+	318477: '挘',
+	318615: '橛',
+	318662: '泫',
+	318740: '炷',
+	318764: '燄',
+	318771: '犍',
+	318822: '璆',
+	318881: '眶',
+	318885: '睜',
+	319155: '蛼',
+	319239: '蹰',
+	319278: '鄢',
+	319413: '騃',
+	319484: '鼹',
+	421283: '戕',
+	428874: '譃',
+	429267: '餼',
+	429268: '饀',
+	429271: '饍',
+	429337: '魳',
+}
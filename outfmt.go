@@ -0,0 +1,185 @@
+/* See LICENSE for license details. */
+package aozora2fmt
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+/* OutFmt is a table of format strings and markers a FmtRenderer uses to
+   turn a Node tree into a specific output format. Fields with no %
+   verb are literal markers concatenated around a block's body; Ruby,
+   Bouten, Hdr and Tcy take the arguments documented on Node. */
+type OutFmt struct {
+	Ruby     string    /* %s base, %s reading */
+	Bouten   string    /* %s text; "" reuses Ruby with repeated ﹅ */
+	Hdr      [3]string /* by Heading.Level, 1-indexed; %s text */
+	PB       string
+	Tcy      string /* %s text; "" passes the run through unchanged */
+	ParaBegin, ParaEnd, ParaSep string
+	IndentBegin, IndentEnd     string
+	CaptionBegin, CaptionEnd   string
+	QuoteBegin, QuoteEnd       string
+	JidoriBegin, JidoriEnd     string
+	ColophonBegin, ColophonEnd string
+	Escape                     func(string) string /* nil means no escaping needed */
+}
+
+func get_outfmt(format string) *OutFmt {
+	switch format {
+	case "tex":
+		return &OutFmt{
+			Ruby:    "\\ruby{%s}{%s}",
+			Hdr:     [3]string{"\\chapter{%s}", "\\section*{%s}", "\\subsection*{%s}"},
+			PB:      "\\newpage",
+			Tcy:     "\\tatechuyoko{%s}",
+			ParaSep: "\n\n",
+			IndentBegin: "\\begin{quote}\n", IndentEnd: "\n\\end{quote}\n",
+			CaptionBegin: "\\caption{", CaptionEnd: "}\n",
+			QuoteBegin: "\\begin{quotation}\n", QuoteEnd: "\n\\end{quotation}\n",
+			JidoriBegin: "\\hfill ", JidoriEnd: "\\\\",
+		}
+	case "md":
+		return &OutFmt{
+			Ruby:    "<ruby>%s<rp>《</rp><rt>%s</rt><rp>》</rp></ruby>",
+			Hdr:     [3]string{"# %s", "## %s", "### %s"},
+			PB:      "<div style='break-after:always'></div>",
+			ParaSep: "\n\n",
+		}
+	case "epub", "html":
+		return &OutFmt{
+			Ruby:   "<ruby><rb>%s</rb><rt>%s</rt></ruby>",
+			Bouten: "<span class=\"bouten\">%s</span>",
+			Hdr:    [3]string{"<h1>%s</h1>", "<h2>%s</h2>", "<h3>%s</h3>"},
+			PB:     "<div style=\"page-break-after:always\"></div>",
+			Tcy:    "<span class=\"tcy\">%s</span>",
+			ParaBegin: "<p>", ParaEnd: "</p>", ParaSep: "\n",
+			IndentBegin: "<div class=\"indent\">", IndentEnd: "</div>",
+			CaptionBegin: "<figcaption>", CaptionEnd: "</figcaption>",
+			QuoteBegin: "<blockquote>", QuoteEnd: "</blockquote>",
+			JidoriBegin: "<div class=\"jidori\">", JidoriEnd: "</div>",
+			ColophonBegin: "<div class=\"colophon\">", ColophonEnd: "</div>",
+			Escape: html.EscapeString,
+		}
+	case "plain":
+		return &OutFmt{
+			Ruby:    "[%s:%s]",
+			Hdr:     [3]string{"%s", "%s", "%s"},
+			ParaSep: "\n\n",
+		}
+	}
+
+	return nil
+}
+
+/* FmtRenderer renders a Node tree by looking up its formatting in an
+   OutFmt table, the same way get_outfmt/OutFmt drove the old
+   string-replacement pipeline. */
+type FmtRenderer struct {
+	of *OutFmt
+}
+
+/* NewRenderer returns the Renderer for format ("plain", "md", "tex",
+   "html" or "epub"). */
+func NewRenderer(format string) (*FmtRenderer, error) {
+	of := get_outfmt(format)
+	if of == nil {
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+
+	return &FmtRenderer{of}, nil
+}
+
+func (fr *FmtRenderer) Render(w io.Writer, n *Node) error {
+	s, err := fr.render(n)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, s)
+	return err
+}
+
+func (fr *FmtRenderer) render_children(nodes []*Node) (string, error) {
+	var b strings.Builder
+	for _, c := range nodes {
+		s, err := fr.render(c)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+
+	return b.String(), nil
+}
+
+func (fr *FmtRenderer) escape(s string) string {
+	if fr.of.Escape != nil {
+		return fr.of.Escape(s)
+	}
+	return s
+}
+
+func (fr *FmtRenderer) render(n *Node) (string, error) {
+	of := fr.of
+
+	switch n.Kind {
+	case KindText, KindGaiji:
+		return fr.escape(n.Text), nil
+	case KindRuby:
+		return fmt.Sprintf(of.Ruby, fr.escape(n.Text), fr.escape(n.Reading)), nil
+	case KindBouten:
+		text := fr.escape(n.Text)
+		if of.Bouten != "" {
+			return fmt.Sprintf(of.Bouten, text), nil
+		}
+		dots := strings.Repeat("﹅", utf8.RuneCountInString(n.Text))
+		return fmt.Sprintf(of.Ruby, text, dots), nil
+	case KindTatechuyoko:
+		if of.Tcy == "" {
+			return fr.escape(n.Text), nil
+		}
+		return fmt.Sprintf(of.Tcy, fr.escape(n.Text)), nil
+	case KindPageBreak:
+		return of.PB + "\n", nil
+	case KindParagraph:
+		body, err := fr.render_children(n.Children)
+		if err != nil {
+			return "", err
+		}
+		return of.ParaBegin + body + of.ParaEnd + of.ParaSep, nil
+	case KindHeading:
+		level := n.Level
+		if level < 1 || level > len(of.Hdr) {
+			level = 1
+		}
+		return fmt.Sprintf(of.Hdr[level-1], fr.escape(n.Text)) + "\n", nil
+	case KindIndent:
+		body, err := fr.render_children(n.Children)
+		if err != nil {
+			return "", err
+		}
+		return of.IndentBegin + body + of.IndentEnd, nil
+	case KindCaption:
+		body, err := fr.render_children(n.Children)
+		if err != nil {
+			return "", err
+		}
+		return of.CaptionBegin + body + of.CaptionEnd, nil
+	case KindBlockquote:
+		body, err := fr.render_children(n.Children)
+		if err != nil {
+			return "", err
+		}
+		return of.QuoteBegin + body + of.QuoteEnd, nil
+	case KindJidori:
+		return of.JidoriBegin + fr.escape(n.Text) + of.JidoriEnd + "\n", nil
+	case KindColophon:
+		return of.ColophonBegin + fr.escape(n.Text) + of.ColophonEnd + "\n", nil
+	}
+
+	return "", fmt.Errorf("unknown node kind: %d", n.Kind)
+}
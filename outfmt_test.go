@@ -0,0 +1,60 @@
+/* See LICENSE for license details. */
+package aozora2fmt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFmtRendererEscapesHTML(t *testing.T) {
+	doc, err := Parse(strings.NewReader("A & B Corp <legit>\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"html", "epub"} {
+		fr, err := NewRenderer(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := doc.Render(&buf, fr); err != nil {
+			t.Fatal(err)
+		}
+
+		out := buf.String()
+		if strings.Contains(out, "A & B") || strings.Contains(out, "<legit>") {
+			t.Errorf("%s: %q leaked unescaped markup", format, out)
+		}
+		if !strings.Contains(out, "A &amp; B Corp &lt;legit&gt;") {
+			t.Errorf("%s: %q missing expected escaped text", format, out)
+		}
+	}
+}
+
+func TestFmtRendererSeparatesJidoriAndPageBreakFromFollowingText(t *testing.T) {
+	src := "発行者　太郎［＃地付き］\n\n［＃改ページ］\n\n次の文章。\n"
+
+	doc, err := Parse(strings.NewReader(src), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"plain", "md", "tex", "html", "epub"} {
+		fr, err := NewRenderer(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := doc.Render(&buf, fr); err != nil {
+			t.Fatal(err)
+		}
+
+		if out := buf.String(); strings.Contains(out, "太郎次の文章") {
+			t.Errorf("%s: jidori/page-break ran straight into the next paragraph: %q", format, out)
+		}
+	}
+}
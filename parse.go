@@ -0,0 +1,213 @@
+/* See LICENSE for license details. */
+package aozora2fmt
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* digit_class matches an Aozora chuki amount in either ASCII or
+   full-width digits, e.g. both "2字下げ" and "２字下げ" appear in the
+   wild. */
+const digit_class = `([0-9０-９]+)`
+
+var (
+	hdr_marker_exp   = regexp.MustCompile(`［＃「([^」]+)」は([大中小])見出し］`)
+	pagebreak_exp    = regexp.MustCompile(`^［＃改ページ］$`)
+	indent_begin_exp = regexp.MustCompile(`^［＃ここから` + digit_class + `字下げ］$`)
+	indent_end_exp   = regexp.MustCompile(`^［＃ここで字下げ終わり］$`)
+	caption_begin_exp = regexp.MustCompile(`^［＃ここから` + digit_class + `字下げでキャプション］$`)
+	caption_end_exp   = regexp.MustCompile(`^［＃キャプション終わり］$`)
+	quote_begin_exp   = regexp.MustCompile(`^［＃ここから引用］$`)
+	quote_end_exp     = regexp.MustCompile(`^［＃引用終わり］$`)
+	jidori_exp        = regexp.MustCompile(`(.*)［＃地付き］$`)
+	jiage_exp         = regexp.MustCompile(`(.*)［＃地から` + digit_class + `字上げ］$`)
+	colophon_exp      = regexp.MustCompile(`^底本：`)
+
+	info_delim = strings.Repeat("-", 55)
+)
+
+/* atoi_amount parses a chuki amount captured by digit_class, which may
+   use full-width digits, into an int. */
+func atoi_amount(s string) int {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '０' && r <= '９' {
+			r = r - '０' + '0'
+		}
+		b.WriteRune(r)
+	}
+
+	n, _ := strconv.Atoi(b.String())
+	return n
+}
+
+func read_lines(r io.Reader) ([]string, error) {
+	var lines []string
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := apply_accents(strings.Trim(s.Text(), "　"))
+		lines = append(lines, line)
+	}
+
+	return lines, s.Err()
+}
+
+/* drop_legend removes the 外字 legend block Aozora sandwiches between a
+   pair of 55-dash rules at the top of the file, same as the old
+   trim_info did on the joined string. */
+func drop_legend(lines []string, debug bool) []string {
+	if debug {
+		return lines
+	}
+
+	first, second := -1, -1
+	for i, line := range lines {
+		if line != info_delim {
+			continue
+		}
+		if first == -1 {
+			first = i
+		} else {
+			second = i
+			break
+		}
+	}
+
+	if first == -1 || second == -1 {
+		return lines
+	}
+
+	out := append([]string{}, lines[:first]...)
+	return append(out, lines[second+1:]...)
+}
+
+/* block is an open ここから.../ここで…終わり container being built while
+   walking the line list. */
+type block struct {
+	node *Node
+	end  *regexp.Regexp
+}
+
+/* Parse reads an Aozora Bunko document from r, decoded to UTF-8 already,
+   and builds its Document tree. debug keeps the 外字 legend block and
+   the colophon that a plain render would otherwise drop. */
+func Parse(r io.Reader, debug bool) (*Document, error) {
+	lines, err := read_lines(r)
+	if err != nil {
+		return nil, err
+	}
+	lines = drop_legend(lines, debug)
+
+	doc := &Document{}
+	append_node := func(n *Node) {
+		doc.Nodes = append(doc.Nodes, n)
+	}
+
+	var stack []block
+	push := func(n *Node, end *regexp.Regexp) { stack = append(stack, block{n, end}) }
+	pop := func() {
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if len(stack) == 0 {
+			append_node(b.node)
+		} else {
+			top := stack[len(stack)-1].node
+			top.Children = append(top.Children, b.node)
+		}
+	}
+	emit := func(n *Node) {
+		if len(stack) == 0 {
+			append_node(n)
+			return
+		}
+		top := stack[len(stack)-1].node
+		top.Children = append(top.Children, n)
+	}
+
+	var para []string
+	flush_para := func() {
+		if len(para) == 0 {
+			return
+		}
+		text := strings.Join(para, "\n")
+		para = para[:0]
+
+		if colophon_exp.MatchString(text) && !debug {
+			return
+		}
+		if colophon_exp.MatchString(text) {
+			emit(&Node{Kind: KindColophon, Text: text})
+			return
+		}
+
+		emit(&Node{Kind: KindParagraph, Children: tokenize_inline(text)})
+	}
+
+	for _, line := range lines {
+		switch {
+		case line == "":
+			flush_para()
+			continue
+		case pagebreak_exp.MatchString(line):
+			flush_para()
+			emit(&Node{Kind: KindPageBreak})
+		case hdr_marker_exp.MatchString(line):
+			flush_para()
+			m := hdr_marker_exp.FindStringSubmatch(line)
+			emit(&Node{Kind: KindHeading, Text: m[1], Level: hdr_level(m[2])})
+		case indent_begin_exp.MatchString(line):
+			flush_para()
+			amount := atoi_amount(indent_begin_exp.FindStringSubmatch(line)[1])
+			push(&Node{Kind: KindIndent, Amount: amount}, indent_end_exp)
+		case len(stack) > 0 && stack[len(stack)-1].end == indent_end_exp && indent_end_exp.MatchString(line):
+			flush_para()
+			pop()
+		case caption_begin_exp.MatchString(line):
+			flush_para()
+			amount := atoi_amount(caption_begin_exp.FindStringSubmatch(line)[1])
+			push(&Node{Kind: KindCaption, Amount: amount}, caption_end_exp)
+		case len(stack) > 0 && stack[len(stack)-1].end == caption_end_exp && caption_end_exp.MatchString(line):
+			flush_para()
+			pop()
+		case quote_begin_exp.MatchString(line):
+			flush_para()
+			push(&Node{Kind: KindBlockquote}, quote_end_exp)
+		case len(stack) > 0 && stack[len(stack)-1].end == quote_end_exp && quote_end_exp.MatchString(line):
+			flush_para()
+			pop()
+		case jiage_exp.MatchString(line):
+			flush_para()
+			m := jiage_exp.FindStringSubmatch(line)
+			width := atoi_amount(m[2])
+			emit(&Node{Kind: KindJidori, Text: m[1], Width: width})
+		case jidori_exp.MatchString(line):
+			flush_para()
+			m := jidori_exp.FindStringSubmatch(line)
+			emit(&Node{Kind: KindJidori, Text: m[1]})
+		default:
+			para = append(para, line)
+		}
+	}
+	flush_para()
+	for len(stack) > 0 {
+		pop()
+	}
+
+	return doc, nil
+}
+
+func hdr_level(suijun string) int {
+	switch suijun {
+	case "大":
+		return 1
+	case "中":
+		return 2
+	default:
+		return 3
+	}
+}
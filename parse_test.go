@@ -0,0 +1,61 @@
+/* See LICENSE for license details. */
+package aozora2fmt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDoesNotPromoteIsolatedParagraphsToHeadings(t *testing.T) {
+	src := "A & B Corp\n\n一つの文。\n\n［＃「本当の見出し」は大見出し］\n\nもう一つの文。\n"
+
+	doc, err := Parse(strings.NewReader(src), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var headings []string
+	for _, n := range doc.Nodes {
+		if n.Kind == KindHeading {
+			headings = append(headings, n.Text)
+		}
+	}
+
+	if len(headings) != 1 || headings[0] != "本当の見出し" {
+		t.Fatalf("headings = %v, want only the explicit 大見出し marker", headings)
+	}
+
+	if doc.Nodes[0].Kind != KindParagraph {
+		t.Fatalf("Nodes[0].Kind = %v, want KindParagraph for a plain isolated line", doc.Nodes[0].Kind)
+	}
+}
+
+func TestParseAcceptsFullWidthChukiAmounts(t *testing.T) {
+	src := "［＃ここから２字下げ］\n字下げされた行。\n［＃ここで字下げ終わり］\n\n" +
+		"地付きの行［＃地から３字上げ］\n"
+
+	doc, err := Parse(strings.NewReader(src), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Nodes) < 1 || doc.Nodes[0].Kind != KindIndent {
+		t.Fatalf("Nodes[0] = %+v, want a KindIndent block", doc.Nodes)
+	}
+	if doc.Nodes[0].Amount != 2 {
+		t.Errorf("Indent.Amount = %d, want 2 (from full-width ２)", doc.Nodes[0].Amount)
+	}
+
+	var jidori *Node
+	for _, n := range doc.Nodes {
+		if n.Kind == KindJidori {
+			jidori = n
+		}
+	}
+	if jidori == nil {
+		t.Fatal("no KindJidori node found")
+	}
+	if jidori.Width != 3 {
+		t.Errorf("Jidori.Width = %d, want 3 (from full-width ３)", jidori.Width)
+	}
+}
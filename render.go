@@ -0,0 +1,20 @@
+/* See LICENSE for license details. */
+package aozora2fmt
+
+import "io"
+
+/* Renderer turns a single Node into output on w. Block kinds are
+   expected to recurse into their own Children. */
+type Renderer interface {
+	Render(w io.Writer, n *Node) error
+}
+
+/* Render writes every top-level node of d to w using r, in order. */
+func (d *Document) Render(w io.Writer, r Renderer) error {
+	for _, n := range d.Nodes {
+		if err := r.Render(w, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
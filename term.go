@@ -0,0 +1,215 @@
+/* See LICENSE for license details. */
+package aozora2fmt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	ansi_reset     = "\x1b[0m"
+	ansi_bold      = "\x1b[1m"
+	ansi_dim       = "\x1b[2m"
+	ansi_underline = "\x1b[4m"
+	ansi_cyan      = "\x1b[36m"
+)
+
+/* MaxTermWidth is the widest line a TermRenderer will ever wrap to,
+   matching the cap glamour uses for terminal markdown rendering. */
+const MaxTermWidth = 100
+
+/* 禁則処理: characters that may never open a line or close one. */
+const (
+	term_no_line_start = "、。，．）」』】〉》〕｝］’”ー・！？"
+	term_no_line_end   = "「『【〈《〔｛［‘“"
+)
+
+/* TermRenderer word-wraps and colorizes a Node tree for a terminal of
+   the given width, treating kanji/kana as two columns wide. Construct
+   with the width reported by the terminal, clamped to MaxTermWidth. */
+type TermRenderer struct {
+	width int
+}
+
+func NewTermRenderer(width int) *TermRenderer {
+	if width <= 0 || width > MaxTermWidth {
+		width = MaxTermWidth
+	}
+
+	return &TermRenderer{width}
+}
+
+func (tr *TermRenderer) Render(w io.Writer, n *Node) error {
+	s, err := tr.render(n)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, s)
+	return err
+}
+
+func (tr *TermRenderer) render_children(nodes []*Node) (string, error) {
+	var b strings.Builder
+	for _, c := range nodes {
+		s, err := tr.render(c)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+
+	return b.String(), nil
+}
+
+func (tr *TermRenderer) render(n *Node) (string, error) {
+	switch n.Kind {
+	case KindText, KindGaiji, KindTatechuyoko:
+		return n.Text, nil
+	case KindRuby:
+		return ansi_underline + n.Text + ansi_reset + ansi_dim + "(" + n.Reading + ")" + ansi_reset, nil
+	case KindBouten:
+		var b strings.Builder
+		for _, r := range n.Text {
+			b.WriteRune(r)
+			b.WriteRune('̇') /* combining dot above */
+		}
+		return b.String(), nil
+	case KindPageBreak:
+		return "\n" + strings.Repeat("─", tr.width) + "\n\n", nil
+	case KindParagraph:
+		body, err := tr.render_children(n.Children)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(word_wrap(body, tr.width), "\n") + "\n\n", nil
+	case KindHeading:
+		color := ansi_bold + ansi_cyan
+		switch n.Level {
+		case 2:
+			color = ansi_bold
+		case 3:
+			color = ansi_underline
+		}
+		return color + n.Text + ansi_reset + "\n\n", nil
+	case KindIndent:
+		body, err := tr.render_children(n.Children)
+		if err != nil {
+			return "", err
+		}
+		return indent_lines(body, n.Amount), nil
+	case KindCaption, KindBlockquote:
+		body, err := tr.render_children(n.Children)
+		if err != nil {
+			return "", err
+		}
+		return ansi_dim + body + ansi_reset, nil
+	case KindJidori:
+		return pad_right_align(n.Text, tr.width) + "\n", nil
+	case KindColophon:
+		return ansi_dim + n.Text + ansi_reset + "\n", nil
+	}
+
+	return "", fmt.Errorf("unknown node kind: %d", n.Kind)
+}
+
+func indent_lines(body string, amount int) string {
+	prefix := strings.Repeat("　", amount)
+
+	lines := strings.Split(strings.TrimRight(body, "\n"), "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = prefix + l
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n\n"
+}
+
+func pad_right_align(text string, width int) string {
+	w := 0
+	for _, r := range text {
+		w += display_width(r)
+	}
+
+	pad := width - w
+	if pad < 0 {
+		pad = 0
+	}
+
+	return strings.Repeat(" ", pad) + text
+}
+
+/* display_width is 2 for characters conventionally rendered full-width
+   in a CJK terminal font, 1 otherwise. */
+func display_width(r rune) int {
+	switch {
+	case r >= 0x1100 && r <= 0x115F, /* Hangul Jamo */
+		r >= 0x2E80 && r <= 0xA4CF, /* CJK radicals, kana, CJK ideographs */
+		r >= 0xAC00 && r <= 0xD7A3, /* Hangul syllables */
+		r >= 0xF900 && r <= 0xFAFF, /* CJK compatibility ideographs */
+		r >= 0xFF00 && r <= 0xFF60, /* fullwidth forms */
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x20000 && r <= 0x3FFFD:
+		return 2
+	}
+
+	return 1
+}
+
+/* word_wrap reflows s to width columns, treating ANSI SGR sequences as
+   zero-width and applying 禁則処理 by letting a line run over by its
+   trailing forbidden punctuation rather than opening the next line
+   with it. */
+func word_wrap(s string, width int) []string {
+	var lines []string
+	var cur strings.Builder
+
+	col := 0
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if r == 0x1b {
+			cur.WriteRune(r)
+			if i+1 < len(runes) && runes[i+1] == '[' {
+				i++
+				cur.WriteRune(runes[i])
+			}
+			for i++; i < len(runes); i++ {
+				cur.WriteRune(runes[i])
+				if runes[i] >= 0x40 && runes[i] <= 0x7E {
+					break
+				}
+			}
+			continue
+		}
+
+		w := display_width(r)
+		if col+w > width && col > 0 && !strings.ContainsRune(term_no_line_start, r) {
+			line := []rune(cur.String())
+			carry := ""
+			if len(line) > 0 && strings.ContainsRune(term_no_line_end, line[len(line)-1]) {
+				carry = string(line[len(line)-1])
+				line = line[:len(line)-1]
+			}
+
+			lines = append(lines, string(line))
+			cur.Reset()
+			cur.WriteString(carry)
+			col = 0
+			for _, cr := range carry {
+				col += display_width(cr)
+			}
+		}
+
+		cur.WriteRune(r)
+		col += w
+	}
+	if cur.Len() > 0 {
+		lines = append(lines, cur.String())
+	}
+
+	return lines
+}